@@ -0,0 +1,116 @@
+package secure_stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEncryptToWriterAndStreamAEADFromByteWithRange(t *testing.T) {
+	sourceData := []byte("HelloSecureStreamingWorld! This is a longer payload than a single short string.")
+
+	key := []byte("examplekey123456examplekey123456")[:32]
+	baseNonce := make([]byte, aeadNonceSize)
+
+	var framed bytes.Buffer
+	if err := EncryptToWriter(bytes.NewReader(sourceData), &framed, key, baseNonce); err != nil {
+		t.Fatalf("EncryptToWriter error: %v", err)
+	}
+
+	store := bytes.NewReader(framed.Bytes())
+
+	recorder := httptest.NewRecorder()
+	err := StreamAEADFromByteWithRange(recorder, store, int64(store.Len()), key, "bytes=6-25")
+	if err != nil {
+		t.Fatalf("StreamAEADFromByteWithRange error: %v", err)
+	}
+
+	expected := sourceData[6:26]
+	if !bytes.Equal(recorder.Body.Bytes(), expected) {
+		t.Errorf("decrypted range mismatch, result: %s, expected: %s", recorder.Body.Bytes(), expected)
+	}
+
+	contentRange := recorder.Header().Get("Content-Range")
+	if contentRange != "bytes 6-25/79" {
+		t.Errorf("Content-Range mismatch, result: %s", contentRange)
+	}
+}
+
+// TestEncryptToWriterAndStreamAEADFromByteWithRangeMultiSegment shrinks
+// aeadSegmentSize so a modest payload still spans several segments,
+// exercising the firstSeg/lastSeg assembly loop with a range that crosses
+// a segment boundary.
+func TestEncryptToWriterAndStreamAEADFromByteWithRangeMultiSegment(t *testing.T) {
+	origSegmentSize := aeadSegmentSize
+	aeadSegmentSize = 16
+	defer func() { aeadSegmentSize = origSegmentSize }()
+
+	sourceData := []byte("HelloSecureStreamingWorld! This payload spans several 16-byte AEAD segments.")
+
+	key := []byte("examplekey123456examplekey123456")[:32]
+	baseNonce := make([]byte, aeadNonceSize)
+
+	var framed bytes.Buffer
+	if err := EncryptToWriter(bytes.NewReader(sourceData), &framed, key, baseNonce); err != nil {
+		t.Fatalf("EncryptToWriter error: %v", err)
+	}
+
+	store := bytes.NewReader(framed.Bytes())
+
+	recorder := httptest.NewRecorder()
+	err := StreamAEADFromByteWithRange(recorder, store, int64(store.Len()), key, "bytes=10-40")
+	if err != nil {
+		t.Fatalf("StreamAEADFromByteWithRange error: %v", err)
+	}
+
+	expected := sourceData[10:41]
+	if !bytes.Equal(recorder.Body.Bytes(), expected) {
+		t.Errorf("decrypted range mismatch, result: %s, expected: %s", recorder.Body.Bytes(), expected)
+	}
+}
+
+// TestStreamAEADFromByteWithRangeRejectsCorruptHeader crafts a header with
+// a zero segment size, which must be rejected as an explicit error rather
+// than panicking with a divide-by-zero in StreamAEADFromByteWithRange.
+func TestStreamAEADFromByteWithRangeRejectsCorruptHeader(t *testing.T) {
+	sourceData := []byte("HelloSecureStreamingWorld!")
+
+	key := []byte("examplekey123456examplekey123456")[:32]
+	baseNonce := make([]byte, aeadNonceSize)
+
+	var framed bytes.Buffer
+	if err := EncryptToWriter(bytes.NewReader(sourceData), &framed, key, baseNonce); err != nil {
+		t.Fatalf("EncryptToWriter error: %v", err)
+	}
+
+	corrupt := framed.Bytes()
+	binary.BigEndian.PutUint32(corrupt[5:9], 0) // zero out the segment size field
+
+	recorder := httptest.NewRecorder()
+	err := StreamAEADFromByteWithRange(recorder, bytes.NewReader(corrupt), int64(len(corrupt)), key, "")
+	if err == nil {
+		t.Fatal("expected an error for a zero segment size header, got nil")
+	}
+}
+
+func TestStreamAEADFromByteWithRangeRejectsTamperedTag(t *testing.T) {
+	sourceData := []byte("HelloSecureStreamingWorld!")
+
+	key := []byte("examplekey123456examplekey123456")[:32]
+	baseNonce := make([]byte, aeadNonceSize)
+
+	var framed bytes.Buffer
+	if err := EncryptToWriter(bytes.NewReader(sourceData), &framed, key, baseNonce); err != nil {
+		t.Fatalf("EncryptToWriter error: %v", err)
+	}
+
+	tampered := framed.Bytes()
+	tampered[len(tampered)-1] ^= 0xFF
+
+	recorder := httptest.NewRecorder()
+	err := StreamAEADFromByteWithRange(recorder, bytes.NewReader(tampered), int64(len(tampered)), key, "")
+	if err == nil {
+		t.Fatal("expected tag verification failure, got nil error")
+	}
+}
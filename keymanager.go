@@ -0,0 +1,158 @@
+package secure_stream
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	keyManagerKeySize       = 32
+	keyManagerIVSize        = 16
+	keyManagerSaltSize      = 16
+	defaultPBKDF2Iterations = 200_000
+)
+
+// KeyManager derives and holds the AES key/IV pair used to encrypt and
+// decrypt streams, so callers don't have to pass raw key, iv []byte pairs
+// around and, worse, reuse the same pair across unrelated objects, which is
+// a catastrophic failure mode under CTR.
+type KeyManager struct {
+	key []byte // 32 bytes
+	iv  []byte // 16 bytes, the base IV subkeys are derived relative to
+}
+
+// NewKeyManagerFromPassphrase derives a KeyManager's master key and base IV
+// from pass using PBKDF2-HMAC-SHA256. salt defaults to 16 random bytes when
+// nil; iterations defaults to 200,000 when 0.
+func NewKeyManagerFromPassphrase(pass []byte, salt []byte, iterations int) (*KeyManager, error) {
+	if iterations == 0 {
+		iterations = defaultPBKDF2Iterations
+	}
+	if salt == nil {
+		salt = make([]byte, keyManagerSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+
+	derived := pbkdf2.Key(pass, salt, iterations, keyManagerKeySize+keyManagerIVSize, sha256.New)
+	return &KeyManager{
+		key: derived[:keyManagerKeySize],
+		iv:  derived[keyManagerKeySize:],
+	}, nil
+}
+
+// DeriveStreamKey derives a (key, iv) pair unique to objectID via HKDF over
+// the manager's master key, so every object gets its own subkey instead of
+// every caller reusing one (key, iv) pair across objects.
+func (km *KeyManager) DeriveStreamKey(objectID string) (key, iv []byte, err error) {
+	h := hkdf.New(sha256.New, km.key, km.iv, []byte(objectID))
+	sub := make([]byte, keyManagerKeySize+keyManagerIVSize)
+	if _, err := io.ReadFull(h, sub); err != nil {
+		return nil, nil, err
+	}
+	return sub[:keyManagerKeySize], sub[keyManagerKeySize:], nil
+}
+
+const (
+	keyManagerBlobMagic      = "KMGR"
+	keyManagerBlobVersion    = 1
+	keyManagerNonceSize      = 24
+	keyManagerBlobHeaderSize = 4 + 1 + 4 + keyManagerSaltSize + keyManagerNonceSize
+)
+
+// ExportEncrypted serializes the manager's key material sealed with NaCl
+// secretbox, using a key derived from pass and a random salt via PBKDF2.
+// The blob is self-describing: magic, version, iteration count, salt,
+// nonce, then the sealed key+IV.
+func (km *KeyManager) ExportEncrypted(pass []byte) ([]byte, error) {
+	salt := make([]byte, keyManagerSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	var nonce [keyManagerNonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	wrapKey := deriveWrapKey(pass, salt, defaultPBKDF2Iterations)
+
+	plaintext := append(append([]byte(nil), km.key...), km.iv...)
+	sealed := secretbox.Seal(nil, plaintext, &nonce, &wrapKey)
+
+	blob := make([]byte, 0, keyManagerBlobHeaderSize+len(sealed))
+	blob = append(blob, []byte(keyManagerBlobMagic)...)
+	blob = append(blob, keyManagerBlobVersion)
+
+	var iterBuf [4]byte
+	binary.BigEndian.PutUint32(iterBuf[:], uint32(defaultPBKDF2Iterations))
+	blob = append(blob, iterBuf[:]...)
+	blob = append(blob, salt...)
+	blob = append(blob, nonce[:]...)
+	blob = append(blob, sealed...)
+
+	return blob, nil
+}
+
+// ImportEncrypted reverses ExportEncrypted, recovering the KeyManager from
+// blob using pass.
+func ImportEncrypted(blob []byte, pass []byte) (*KeyManager, error) {
+	if len(blob) < keyManagerBlobHeaderSize {
+		return nil, errors.New("secure_stream: encrypted key blob is too short")
+	}
+	if string(blob[0:4]) != keyManagerBlobMagic {
+		return nil, errors.New("secure_stream: not a KeyManager blob: bad magic")
+	}
+	if blob[4] != keyManagerBlobVersion {
+		return nil, fmt.Errorf("secure_stream: unsupported KeyManager blob version %d", blob[4])
+	}
+
+	iterations := binary.BigEndian.Uint32(blob[5:9])
+	salt := blob[9 : 9+keyManagerSaltSize]
+	var nonce [keyManagerNonceSize]byte
+	copy(nonce[:], blob[9+keyManagerSaltSize:keyManagerBlobHeaderSize])
+	sealed := blob[keyManagerBlobHeaderSize:]
+
+	wrapKey := deriveWrapKey(pass, salt, int(iterations))
+
+	plaintext, ok := secretbox.Open(nil, sealed, &nonce, &wrapKey)
+	if !ok {
+		return nil, errors.New("secure_stream: failed to decrypt KeyManager blob: wrong passphrase or corrupted data")
+	}
+	if len(plaintext) != keyManagerKeySize+keyManagerIVSize {
+		return nil, errors.New("secure_stream: decrypted KeyManager blob has unexpected length")
+	}
+
+	return &KeyManager{
+		key: append([]byte(nil), plaintext[:keyManagerKeySize]...),
+		iv:  append([]byte(nil), plaintext[keyManagerKeySize:]...),
+	}, nil
+}
+
+func deriveWrapKey(pass, salt []byte, iterations int) [32]byte {
+	derived := pbkdf2.Key(append(append([]byte(nil), pass...), salt...), salt, iterations, 32, sha256.New)
+	var key [32]byte
+	copy(key[:], derived)
+	return key
+}
+
+// StreamFromByteWithKM decrypts data (size bytes long) using the subkey
+// KeyManager derives for objectID, so callers never have to manage a raw
+// (key, iv) pair themselves.
+func StreamFromByteWithKM(w http.ResponseWriter, data io.ReaderAt, size int64, km *KeyManager, objectID string, byteRange string, opts *StreamOptions) error {
+	key, iv, err := km.DeriveStreamKey(objectID)
+	if err != nil {
+		return err
+	}
+	return StreamFromByteWithRange(w, data, size, key, iv, byteRange, opts)
+}
@@ -0,0 +1,93 @@
+package secure_stream
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeyManagerExportImportRoundTrip(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	km, err := NewKeyManagerFromPassphrase([]byte("correct horse battery staple"), salt, 1000)
+	if err != nil {
+		t.Fatalf("NewKeyManagerFromPassphrase: %v", err)
+	}
+
+	blob, err := km.ExportEncrypted([]byte("export passphrase"))
+	if err != nil {
+		t.Fatalf("ExportEncrypted: %v", err)
+	}
+
+	imported, err := ImportEncrypted(blob, []byte("export passphrase"))
+	if err != nil {
+		t.Fatalf("ImportEncrypted: %v", err)
+	}
+
+	if !bytes.Equal(km.key, imported.key) || !bytes.Equal(km.iv, imported.iv) {
+		t.Error("imported KeyManager does not match the original")
+	}
+
+	if _, err := ImportEncrypted(blob, []byte("wrong passphrase")); err == nil {
+		t.Error("expected ImportEncrypted to fail with the wrong passphrase")
+	}
+}
+
+func TestKeyManagerDeriveStreamKeyIsPerObject(t *testing.T) {
+	km, err := NewKeyManagerFromPassphrase([]byte("a passphrase"), []byte("0123456789abcdef"), 1000)
+	if err != nil {
+		t.Fatalf("NewKeyManagerFromPassphrase: %v", err)
+	}
+
+	keyA, ivA, err := km.DeriveStreamKey("object-a")
+	if err != nil {
+		t.Fatalf("DeriveStreamKey: %v", err)
+	}
+	keyB, ivB, err := km.DeriveStreamKey("object-b")
+	if err != nil {
+		t.Fatalf("DeriveStreamKey: %v", err)
+	}
+
+	if bytes.Equal(keyA, keyB) && bytes.Equal(ivA, ivB) {
+		t.Error("expected distinct objects to derive distinct subkeys")
+	}
+
+	keyAAgain, ivAAgain, err := km.DeriveStreamKey("object-a")
+	if err != nil {
+		t.Fatalf("DeriveStreamKey: %v", err)
+	}
+	if !bytes.Equal(keyA, keyAAgain) || !bytes.Equal(ivA, ivAAgain) {
+		t.Error("expected DeriveStreamKey to be deterministic for the same objectID")
+	}
+}
+
+func TestStreamFromByteWithKM(t *testing.T) {
+	km, err := NewKeyManagerFromPassphrase([]byte("a passphrase"), []byte("0123456789abcdef"), 1000)
+	if err != nil {
+		t.Fatalf("NewKeyManagerFromPassphrase: %v", err)
+	}
+
+	key, iv, err := km.DeriveStreamKey("object-a")
+	if err != nil {
+		t.Fatalf("DeriveStreamKey: %v", err)
+	}
+
+	plain := []byte("HelloSecureStreamingWorld!")
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+	ciphertext := make([]byte, len(plain))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plain)
+
+	recorder := httptest.NewRecorder()
+	err = StreamFromByteWithKM(recorder, bytes.NewReader(ciphertext), int64(len(ciphertext)), km, "object-a", "", nil)
+	if err != nil {
+		t.Fatalf("StreamFromByteWithKM error: %v", err)
+	}
+
+	if !bytes.Equal(recorder.Body.Bytes(), plain) {
+		t.Errorf("decrypted mismatch, result: %s, expected: %s", recorder.Body.Bytes(), plain)
+	}
+}
@@ -0,0 +1,197 @@
+package secure_stream
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"log"
+)
+
+// StreamMode abstracts over the block cipher mode used to turn a
+// ciphertext io.Reader into a plaintext io.Reader starting at a given byte
+// offset. CTR and OFB are true stream ciphers and just wrap the stdlib
+// cipher.Stream; CBC decrypts whole blocks and strips PKCS#7 padding once
+// its source is exhausted, which doesn't fit XORKeyStream's synchronous,
+// padding-unaware signature, so it gets its own buffering io.Reader below.
+type StreamMode interface {
+	NewReader(block cipher.Block, iv []byte, offset int64, src io.Reader) (io.Reader, error)
+	// SupportsRandomAccess reports whether NewReader accepts a non-zero offset.
+	SupportsRandomAccess() bool
+}
+
+// CTRMode is today's default: AES-CTR, which supports seeking to any byte
+// offset by advancing the counter half of the IV (see adjustIVForOffset) and
+// discarding the leading offset%blockSize keystream bytes within that block.
+type CTRMode struct{}
+
+func (CTRMode) NewReader(block cipher.Block, iv []byte, offset int64, src io.Reader) (io.Reader, error) {
+	adjusted := adjustIVForOffset(iv, offset)
+	stream := cipher.NewCTR(block, adjusted)
+
+	if skip := int(offset % int64(block.BlockSize())); skip > 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+
+	return &cipher.StreamReader{S: stream, R: src}, nil
+}
+
+func (CTRMode) SupportsRandomAccess() bool { return true }
+
+// OFBMode is AES-OFB. Each OFB keystream block depends on the full chain
+// of prior blocks, so a stream can only be decrypted from the start.
+type OFBMode struct{}
+
+func (OFBMode) NewReader(block cipher.Block, iv []byte, offset int64, src io.Reader) (io.Reader, error) {
+	if offset != 0 {
+		return nil, errors.New("secure_stream: OFB mode does not support random access, offset must be 0")
+	}
+	stream := cipher.NewOFB(block, iv)
+	return &cipher.StreamReader{S: stream, R: src}, nil
+}
+
+func (OFBMode) SupportsRandomAccess() bool { return false }
+
+// CBCMode is AES-CBC with PKCS#7 padding. Like OFB, decrypting block N
+// needs ciphertext block N-1 as the chaining value, so there's no random
+// access either.
+type CBCMode struct{}
+
+func (CBCMode) NewReader(block cipher.Block, iv []byte, offset int64, src io.Reader) (io.Reader, error) {
+	if offset != 0 {
+		return nil, errors.New("secure_stream: CBC mode does not support random access, offset must be 0")
+	}
+	return &cbcReader{block: block, iv: iv, src: src}, nil
+}
+
+func (CBCMode) SupportsRandomAccess() bool { return false }
+
+// cbcReader decrypts a CBC ciphertext one block at a time into an internal
+// buffer so that io.Copy's arbitrary read sizes keep working, holding back
+// the most recently read ciphertext block undecrypted until it knows
+// whether src is exhausted, since only the true final block has its PKCS#7
+// padding stripped.
+type cbcReader struct {
+	block cipher.Block
+	iv    []byte
+	src   io.Reader
+
+	mode    cipher.BlockMode
+	buf     bytes.Buffer
+	pending []byte
+	eof     bool
+}
+
+func (r *cbcReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && !r.eof {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	if r.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return r.buf.Read(p)
+}
+
+func (r *cbcReader) fill() error {
+	if r.mode == nil {
+		r.mode = cipher.NewCBCDecrypter(r.block, r.iv)
+	}
+	blockSize := r.block.BlockSize()
+
+	chunk := make([]byte, blockSize)
+	n, err := io.ReadFull(r.src, chunk)
+	switch {
+	case n == blockSize:
+		if r.pending != nil {
+			if err := r.decryptBlock(r.pending, false); err != nil {
+				return err
+			}
+		}
+		r.pending = chunk
+		return nil
+	case n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF):
+		if r.pending == nil {
+			return errors.New("secure_stream: CBC ciphertext is empty")
+		}
+		if err := r.decryptBlock(r.pending, true); err != nil {
+			return err
+		}
+		r.pending = nil
+		r.eof = true
+		return nil
+	default:
+		return errors.New("secure_stream: CBC ciphertext length is not a multiple of the block size")
+	}
+}
+
+func (r *cbcReader) decryptBlock(ciphertext []byte, last bool) error {
+	plain := make([]byte, len(ciphertext))
+	r.mode.CryptBlocks(plain, ciphertext)
+	if last {
+		unpadded, err := stripPKCS7(plain)
+		if err != nil {
+			return err
+		}
+		plain = unpadded
+	}
+	r.buf.Write(plain)
+	return nil
+}
+
+// stripPKCS7 removes PKCS#7 padding from data, verifying that all padLen
+// trailing bytes equal padLen as the scheme requires rather than trusting
+// the last byte alone, so a corrupted or truncated final block is rejected
+// instead of silently producing wrong-length plaintext.
+func stripPKCS7(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("secure_stream: CBC ciphertext is empty")
+	}
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > len(data) {
+		return nil, errors.New("secure_stream: invalid PKCS#7 padding")
+	}
+	for _, b := range data[len(data)-padLen:] {
+		if int(b) != padLen {
+			return nil, errors.New("secure_stream: invalid PKCS#7 padding")
+		}
+	}
+	return data[:len(data)-padLen], nil
+}
+
+// StreamOptions configures how the public Stream* functions encrypt or
+// decrypt and what they report to the client. A nil *StreamOptions (or a
+// zero value) is equivalent to &StreamOptions{Mode: CTRMode{}}.
+type StreamOptions struct {
+	// Mode selects the block cipher mode. Defaults to CTRMode{}.
+	Mode StreamMode
+	// ContentType is sent as the response Content-Type. Defaults to
+	// "application/octet-stream".
+	ContentType string
+	// Logger, if set, receives diagnostic messages. Defaults to discarding them.
+	Logger *log.Logger
+}
+
+const defaultContentType = "application/octet-stream"
+
+func resolveOptions(opts *StreamOptions) StreamOptions {
+	var resolved StreamOptions
+	if opts != nil {
+		resolved = *opts
+	}
+	if resolved.Mode == nil {
+		resolved.Mode = CTRMode{}
+	}
+	if resolved.ContentType == "" {
+		resolved.ContentType = defaultContentType
+	}
+	return resolved
+}
+
+func (o StreamOptions) logf(format string, args ...any) {
+	if o.Logger != nil {
+		o.Logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,112 @@
+package secure_stream
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCBCModeRoundTrip(t *testing.T) {
+	key := []byte("examplekey123456examplekey123456")[:32]
+	iv := make([]byte, aes.BlockSize)
+	plain := []byte("HelloSecureStreamingWorld! CBC needs padding.")
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+
+	padded := append([]byte(nil), plain...)
+	padLen := aes.BlockSize - len(padded)%aes.BlockSize
+	for i := 0; i < padLen; i++ {
+		padded = append(padded, byte(padLen))
+	}
+
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	reader, err := CBCMode{}.NewReader(block, iv, 0, bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+
+	decrypted, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Errorf("CBC round trip mismatch, result: %s, expected: %s", decrypted, plain)
+	}
+}
+
+func TestCBCModeRejectsCorruptedPadding(t *testing.T) {
+	key := []byte("examplekey123456examplekey123456")[:32]
+	iv := make([]byte, aes.BlockSize)
+	plain := []byte("HelloSecureStreamingWorld! CBC needs padding.")
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+
+	padded := append([]byte(nil), plain...)
+	padLen := aes.BlockSize - len(padded)%aes.BlockSize
+	for i := 0; i < padLen; i++ {
+		padded = append(padded, byte(padLen))
+	}
+	padded[len(padded)-2] ^= 0xFF // corrupt a non-final padding byte
+
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	reader, err := CBCMode{}.NewReader(block, iv, 0, bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+
+	if _, err := io.ReadAll(reader); err == nil {
+		t.Error("expected an error from corrupted PKCS#7 padding, got nil")
+	}
+}
+
+func TestOFBModeRejectsOffset(t *testing.T) {
+	key := []byte("examplekey123456examplekey123456")[:32]
+	iv := make([]byte, aes.BlockSize)
+	block, _ := aes.NewCipher(key)
+
+	if _, err := (OFBMode{}).NewReader(block, iv, 32, bytes.NewReader(nil)); err == nil {
+		t.Error("expected OFB mode to reject a non-zero offset")
+	}
+}
+
+func TestStreamFromByteWithCBCMode(t *testing.T) {
+	key := []byte("examplekey123456examplekey123456")[:32]
+	iv := make([]byte, aes.BlockSize)
+	plain := []byte("HelloSecureStreamingWorld!CBC!!")
+
+	block, _ := aes.NewCipher(key)
+	padded := append([]byte(nil), plain...)
+	padLen := aes.BlockSize - len(padded)%aes.BlockSize
+	for i := 0; i < padLen; i++ {
+		padded = append(padded, byte(padLen))
+	}
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	recorder := httptest.NewRecorder()
+	opts := &StreamOptions{Mode: CBCMode{}, ContentType: "text/plain"}
+	err := StreamFromByte(recorder, bytes.NewReader(ciphertext), int64(len(ciphertext)), key, iv, opts)
+	if err != nil {
+		t.Fatalf("StreamFromByte error: %v", err)
+	}
+
+	if !bytes.Equal(recorder.Body.Bytes(), plain) {
+		t.Errorf("decrypted mismatch, result: %s, expected: %s", recorder.Body.Bytes(), plain)
+	}
+	if ct := recorder.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Content-Type mismatch, result: %s", ct)
+	}
+}
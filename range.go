@@ -0,0 +1,164 @@
+package secure_stream
+
+import (
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// HTTPRange is an inclusive byte range within an object, as decoded from an
+// RFC 7233 Range header.
+type HTTPRange struct {
+	Start, End int64
+}
+
+func (r HTTPRange) length() int64 { return r.End - r.Start + 1 }
+
+// ErrRangeNotSatisfiable is returned when a Range header can't be satisfied
+// against an object of the given size; callers should respond 416.
+var ErrRangeNotSatisfiable = errors.New("secure_stream: range not satisfiable")
+
+// multipartByteRangesBoundary is fixed rather than random so responses stay
+// byte-for-byte reproducible.
+const multipartByteRangesBoundary = "SECURE-STREAM-BYTERANGES"
+
+// parseByteRanges parses an RFC 7233 "Range: bytes=..." header against an
+// object of the given size. It supports the start-end, suffix (-N) and
+// open-ended (N-) forms, as well as multiple comma-separated ranges. An
+// empty header yields a single range covering the whole object.
+func parseByteRanges(byteRange string, size int64) ([]HTTPRange, error) {
+	if byteRange == "" {
+		return []HTTPRange{{Start: 0, End: size - 1}}, nil
+	}
+	if !strings.HasPrefix(byteRange, "bytes=") {
+		return nil, fmt.Errorf("invalid range header")
+	}
+	if size <= 0 {
+		return nil, ErrRangeNotSatisfiable
+	}
+
+	specs := strings.Split(strings.TrimPrefix(byteRange, "bytes="), ",")
+	ranges := make([]HTTPRange, 0, len(specs))
+
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		dash := strings.IndexByte(spec, '-')
+		if dash < 0 {
+			return nil, fmt.Errorf("invalid range format")
+		}
+		startPart, endPart := spec[:dash], spec[dash+1:]
+
+		var start, end int64
+		switch {
+		case startPart == "" && endPart == "":
+			return nil, fmt.Errorf("invalid range format")
+
+		case startPart == "": // suffix range: bytes=-N, the last N bytes
+			suffixLen, err := strconv.ParseInt(endPart, 10, 64)
+			if err != nil || suffixLen <= 0 {
+				return nil, fmt.Errorf("invalid suffix range length")
+			}
+			if suffixLen > size {
+				suffixLen = size
+			}
+			start = size - suffixLen
+			end = size - 1
+
+		case endPart == "": // open-ended range: bytes=N-, to EOF
+			s, err := strconv.ParseInt(startPart, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start byte")
+			}
+			start = s
+			end = size - 1
+
+		default:
+			s, err := strconv.ParseInt(startPart, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start byte")
+			}
+			e, err := strconv.ParseInt(endPart, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid end byte")
+			}
+			start, end = s, e
+		}
+
+		if start < 0 || start > end || start >= size {
+			return nil, ErrRangeNotSatisfiable
+		}
+		if end >= size {
+			end = size - 1
+		}
+
+		ranges = append(ranges, HTTPRange{Start: start, End: end})
+	}
+
+	return ranges, nil
+}
+
+// parseByteRange parses a single-range (or empty) header into a
+// (start, length) pair, the form most of this package's single-range
+// callers want. It rejects headers carrying more than one range; use
+// parseByteRanges directly for multi-range support.
+func parseByteRange(byteRange string, size int64) (start int64, length int64, err error) {
+	ranges, err := parseByteRanges(byteRange, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(ranges) > 1 {
+		return 0, 0, fmt.Errorf("secure_stream: multiple ranges not supported here")
+	}
+	r := ranges[0]
+	return r.Start, r.length(), nil
+}
+
+// writeMultipartByteRanges decrypts and writes each of ranges as its own
+// part of a multipart/byteranges response, re-deriving the stream for every
+// part so its IV is adjusted for that part's own starting offset.
+func writeMultipartByteRanges(w http.ResponseWriter, data io.ReaderAt, size int64, key, iv []byte, ranges []HTTPRange, options StreamOptions) error {
+	if !options.Mode.SupportsRandomAccess() {
+		return errors.New("secure_stream: selected mode does not support multi-range requests")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(multipartByteRangesBoundary); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+
+	for _, r := range ranges {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", options.ContentType)
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size))
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		sectionReader := io.NewSectionReader(data, r.Start, r.length())
+		streamReader, err := options.Mode.NewReader(block, iv, r.Start, sectionReader)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, streamReader); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
@@ -0,0 +1,130 @@
+package secure_stream
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseByteRanges(t *testing.T) {
+	const size = 1000
+
+	tests := []struct {
+		name      string
+		byteRange string
+		want      []HTTPRange
+		wantErr   bool
+	}{
+		{"no range", "", []HTTPRange{{0, 999}}, false},
+		{"start-end", "bytes=0-499", []HTTPRange{{0, 499}}, false},
+		{"suffix", "bytes=-500", []HTTPRange{{500, 999}}, false},
+		{"suffix larger than size", "bytes=-5000", []HTTPRange{{0, 999}}, false},
+		{"open-ended", "bytes=500-", []HTTPRange{{500, 999}}, false},
+		{"end beyond size is clamped", "bytes=500-10000", []HTTPRange{{500, 999}}, false},
+		{"multi range", "bytes=0-99,500-599", []HTTPRange{{0, 99}, {500, 599}}, false},
+		{"overlapping multi range", "bytes=0-499,400-599", []HTTPRange{{0, 499}, {400, 599}}, false},
+		{"unsatisfiable start beyond size", "bytes=1000-1999", nil, true},
+		{"unsatisfiable start after end", "bytes=500-100", nil, true},
+		{"malformed", "bytes=abc-def", nil, true},
+		{"missing prefix", "0-499", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseByteRanges(tt.byteRange, size)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseByteRanges(%q) expected an error, got ranges: %v", tt.byteRange, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseByteRanges(%q) unexpected error: %v", tt.byteRange, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseByteRanges(%q) = %v, want %v", tt.byteRange, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("parseByteRanges(%q)[%d] = %v, want %v", tt.byteRange, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStreamFromByteWithRangeUnsatisfiable(t *testing.T) {
+	sourceData := []byte("HelloSecureStreamingWorld!")
+	key := []byte("examplekey123456examplekey123456")[:32]
+	iv := make([]byte, aes.BlockSize)
+
+	recorder := httptest.NewRecorder()
+	err := StreamFromByteWithRange(recorder, bytes.NewReader(sourceData), int64(len(sourceData)), key, iv, "bytes=10000-20000", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recorder.Code != 416 {
+		t.Errorf("status = %d, want 416", recorder.Code)
+	}
+}
+
+func TestStreamFromByteWithRangeMultiRange(t *testing.T) {
+	sourceData := []byte("HelloSecureStreamingWorld! This payload is long enough for two separate ranges.")
+	key := []byte("examplekey123456examplekey123456")[:32]
+	iv := make([]byte, aes.BlockSize)
+
+	block, _ := aes.NewCipher(key)
+	ciphertext := make([]byte, len(sourceData))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, sourceData)
+
+	byteRange := "bytes=0-9,20-39"
+	recorder := httptest.NewRecorder()
+	err := StreamFromByteWithRange(recorder, bytes.NewReader(ciphertext), int64(len(ciphertext)), key, iv, byteRange, nil)
+	if err != nil {
+		t.Fatalf("StreamFromByteWithRange error: %v", err)
+	}
+
+	if recorder.Code != 206 {
+		t.Fatalf("status = %d, want 206", recorder.Code)
+	}
+
+	_, params, err := mime.ParseMediaType(recorder.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("parsing Content-Type: %v", err)
+	}
+
+	mr := multipart.NewReader(recorder.Body, params["boundary"])
+
+	wantRanges := []HTTPRange{{0, 9}, {20, 39}}
+	for i, want := range wantRanges {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("reading part %d: %v", i, err)
+		}
+
+		plain, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("reading part %d body: %v", i, err)
+		}
+
+		expected := sourceData[want.Start : want.End+1]
+		if !bytes.Equal(plain, expected) {
+			t.Errorf("part %d mismatch, result: %s, expected: %s", i, plain, expected)
+		}
+
+		wantCR := fmt.Sprintf("bytes %d-%d/%d", want.Start, want.End, len(sourceData))
+		if got := part.Header.Get("Content-Range"); got != wantCR {
+			t.Errorf("part %d Content-Range = %s, want %s", i, got, wantCR)
+		}
+	}
+
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected exactly two parts, got extra part or error: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package secure_stream
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const (
+	headerSSECAlgorithm = "X-Amz-Server-Side-Encryption-Customer-Algorithm"
+	headerSSECKey       = "X-Amz-Server-Side-Encryption-Customer-Key"
+	headerSSECKeyMD5    = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+)
+
+// sseCHandler is a transparent decrypting proxy compatible with the SSE-C
+// header convention used by tools written against S3: the client supplies
+// the object's AES key on every request instead of the server holding it.
+type sseCHandler struct {
+	upstream string
+
+	mu          sync.Mutex
+	keyMD5Cache map[string]string // object URL -> customer key MD5 last used for it
+}
+
+// NewSSECHandler returns an http.Handler that fetches ciphertext for
+// request.URL.Path from upstream and decrypts it using the customer key
+// carried in the SSE-C request headers, streaming the plaintext back with
+// the same range support as StreamFromUrlWithRange.
+//
+// Objects are assumed to have been encrypted with the zero IV directly
+// under the customer-supplied key. This does not hold for KeyManager
+// subkeys (see StreamFromByteWithKM): DeriveStreamKey derives a non-zero
+// IV via HKDF, and SSE-C's customer-supplied-key model has no way to carry
+// a KeyManager's master secret or objectID, so the two can't be wired
+// together. Callers encrypting with a different IV per object will need
+// their own handler.
+func NewSSECHandler(upstream string) http.Handler {
+	return &sseCHandler{
+		upstream:    upstream,
+		keyMD5Cache: make(map[string]string),
+	}
+}
+
+func (h *sseCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	algorithm := r.Header.Get(headerSSECAlgorithm)
+	keyB64 := r.Header.Get(headerSSECKey)
+	keyMD5B64 := r.Header.Get(headerSSECKeyMD5)
+
+	if algorithm == "" || keyB64 == "" || keyMD5B64 == "" {
+		http.Error(w, "missing SSE-C headers", http.StatusBadRequest)
+		return
+	}
+	if algorithm != "AES256" {
+		http.Error(w, "unsupported SSE-C customer algorithm", http.StatusBadRequest)
+		return
+	}
+
+	key, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil {
+		http.Error(w, "invalid SSE-C customer key encoding", http.StatusBadRequest)
+		return
+	}
+	defer wipeKey(key)
+
+	sum := md5.Sum(key)
+	if base64.StdEncoding.EncodeToString(sum[:]) != keyMD5B64 {
+		http.Error(w, "SSE-C customer key MD5 mismatch", http.StatusBadRequest)
+		return
+	}
+
+	objectURL := h.upstream + r.URL.Path
+	if r.URL.RawQuery != "" {
+		objectURL += "?" + r.URL.RawQuery
+	}
+
+	if !h.sameKeyAsBefore(objectURL, keyMD5B64) {
+		http.Error(w, "object was previously requested with a different customer key", http.StatusForbidden)
+		return
+	}
+
+	iv := make([]byte, 16)
+	w.Header().Set(headerSSECKeyMD5, keyMD5B64)
+
+	if err := StreamFromUrlWithRange(w, objectURL, key, iv, r.Header.Get("Range"), nil); err != nil {
+		http.Error(w, fmt.Sprintf("decrypting object: %v", err), http.StatusBadGateway)
+	}
+}
+
+// sameKeyAsBefore reports whether keyMD5 matches the key MD5 the object was
+// first requested with, recording it the first time the object is seen.
+func (h *sseCHandler) sameKeyAsBefore(objectURL, keyMD5 string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	existing, seen := h.keyMD5Cache[objectURL]
+	if !seen {
+		h.keyMD5Cache[objectURL] = keyMD5
+		return true
+	}
+	return existing == keyMD5
+}
+
+func wipeKey(key []byte) {
+	for i := range key {
+		key[i] = 0
+	}
+}
@@ -0,0 +1,131 @@
+package secure_stream
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func encryptForSSECTest(t *testing.T, key []byte, plain []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	ciphertext := make([]byte, len(plain))
+	stream.XORKeyStream(ciphertext, plain)
+	return ciphertext
+}
+
+func newSSECUpstream(t *testing.T, objectPath string, ciphertext []byte) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != objectPath {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(ciphertext)
+	}))
+}
+
+func TestSSECHandlerDecryptsWithValidKey(t *testing.T) {
+	key := []byte("examplekey123456examplekey123456")[:32]
+	plain := []byte("HelloSecureStreamingWorld!")
+	ciphertext := encryptForSSECTest(t, key, plain)
+
+	upstream := newSSECUpstream(t, "/object1", ciphertext)
+	defer upstream.Close()
+
+	proxy := httptest.NewServer(NewSSECHandler(upstream.URL))
+	defer proxy.Close()
+
+	keyMD5 := md5.Sum(key)
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/object1", nil)
+	req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key", base64.StdEncoding.EncodeToString(key))
+	req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", base64.StdEncoding.EncodeToString(keyMD5[:]))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, plain) {
+		t.Errorf("decrypted mismatch, result: %s, expected: %s", body, plain)
+	}
+	if got := resp.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"); got != base64.StdEncoding.EncodeToString(keyMD5[:]) {
+		t.Errorf("key MD5 not echoed back, got: %s", got)
+	}
+}
+
+func TestSSECHandlerRejectsMD5Mismatch(t *testing.T) {
+	key := []byte("examplekey123456examplekey123456")[:32]
+	upstream := newSSECUpstream(t, "/object1", nil)
+	defer upstream.Close()
+
+	proxy := httptest.NewServer(NewSSECHandler(upstream.URL))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/object1", nil)
+	req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key", base64.StdEncoding.EncodeToString(key))
+	req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", base64.StdEncoding.EncodeToString([]byte("not-the-right-md5!!")))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, expected %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestSSECHandlerRejectsKeyChangeForSameObject(t *testing.T) {
+	key := []byte("examplekey123456examplekey123456")[:32]
+	otherKey := []byte("differentkey456differentkey456!!")[:32]
+	plain := []byte("HelloSecureStreamingWorld!")
+	ciphertext := encryptForSSECTest(t, key, plain)
+
+	upstream := newSSECUpstream(t, "/object1", ciphertext)
+	defer upstream.Close()
+
+	proxy := httptest.NewServer(NewSSECHandler(upstream.URL))
+	defer proxy.Close()
+
+	doRequest := func(k []byte) *http.Response {
+		md5sum := md5.Sum(k)
+		req, _ := http.NewRequest("GET", proxy.URL+"/object1", nil)
+		req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+		req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key", base64.StdEncoding.EncodeToString(k))
+		req.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", base64.StdEncoding.EncodeToString(md5sum[:]))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		return resp
+	}
+
+	first := doRequest(key)
+	first.Body.Close()
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("first request status = %d, expected 200", first.StatusCode)
+	}
+
+	second := doRequest(otherKey)
+	defer second.Body.Close()
+	if second.StatusCode != http.StatusForbidden {
+		t.Errorf("second request status = %d, expected %d", second.StatusCode, http.StatusForbidden)
+	}
+}
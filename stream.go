@@ -2,17 +2,20 @@ package secure_stream
 
 import (
 	"crypto/aes"
-	"crypto/cipher"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
 	"strings"
 )
 
-func StreamFromUrl(w http.ResponseWriter, fileUrl string, key, iv []byte) error {
+func StreamFromUrl(w http.ResponseWriter, fileUrl string, key, iv []byte, opts *StreamOptions) error {
+	options := resolveOptions(opts)
+
 	req, err := http.NewRequest("GET", fileUrl, nil)
 	if err != nil {
 		return err
@@ -20,6 +23,7 @@ func StreamFromUrl(w http.ResponseWriter, fileUrl string, key, iv []byte) error
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		options.logf("StreamFromUrl: fetching %s: %v", fileUrl, err)
 		return err
 	}
 	defer resp.Body.Close()
@@ -29,59 +33,25 @@ func StreamFromUrl(w http.ResponseWriter, fileUrl string, key, iv []byte) error
 		return err
 	}
 
-	stream := cipher.NewCTR(block, iv)
-	streamReader := &cipher.StreamReader{S: stream, R: resp.Body}
+	streamReader, err := options.Mode.NewReader(block, iv, 0, resp.Body)
+	if err != nil {
+		return err
+	}
 
+	w.Header().Set("Content-Type", options.ContentType)
 	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/octet-stream")
 
 	_, err = io.Copy(w, streamReader)
 	return err
 }
 
-// func StreamFromUrlWithRange(w http.ResponseWriter, fileUrl string, key, iv []byte, byteRange string) error {
-// 	req, err := http.NewRequest("GET", fileUrl, nil)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	if byteRange != "" {
-// 		req.Header.Set("Range", byteRange)
-// 	}
-
-// 	resp, err := http.DefaultClient.Do(req)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	defer resp.Body.Close()
-
-// 	offset, err := parseRangeOffset(byteRange)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	adjustedIV := adjustIVForOffset(iv, offset)
-
-// 	block, err := aes.NewCipher(key)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	stream := cipher.NewCTR(block, adjustedIV)
-// 	streamReader := &cipher.StreamReader{S: stream, R: resp.Body}
-
-// 	if resp.StatusCode == http.StatusPartialContent {
-// 		w.WriteHeader(http.StatusPartialContent)
-// 	} else {
-// 		w.WriteHeader(http.StatusOK)
-// 	}
-// 	w.Header().Set("Content-Type", "application/octet-stream")
-
-// 	_, err = io.Copy(w, streamReader)
-// 	return err
-// }
-
-func StreamFromUrlWithRange(w http.ResponseWriter, fileUrl string, key, iv []byte, byteRange string) error {
+func StreamFromUrlWithRange(w http.ResponseWriter, fileUrl string, key, iv []byte, byteRange string, opts *StreamOptions) error {
+	options := resolveOptions(opts)
+
+	if strings.Contains(byteRange, ",") {
+		return streamURLMultipartByteRanges(w, fileUrl, key, iv, byteRange, options)
+	}
+
 	req, err := http.NewRequest("GET", fileUrl, nil)
 	if err != nil {
 		return err
@@ -93,6 +63,7 @@ func StreamFromUrlWithRange(w http.ResponseWriter, fileUrl string, key, iv []byt
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		options.logf("StreamFromUrlWithRange: fetching %s: %v", fileUrl, err)
 		return err
 	}
 	defer resp.Body.Close()
@@ -108,18 +79,30 @@ func StreamFromUrlWithRange(w http.ResponseWriter, fileUrl string, key, iv []byt
 		totalSize, _ = strconv.ParseInt(cl, 10, 64)
 	}
 
-	offset, err := parseRangeOffset(byteRange)
+	ranges, err := parseByteRanges(byteRange, totalSize)
 	if err != nil {
+		if errors.Is(err, ErrRangeNotSatisfiable) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", totalSize))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return nil
+		}
 		return err
 	}
+	offset := ranges[0].Start
+
+	if offset != 0 && !options.Mode.SupportsRandomAccess() {
+		return errors.New("secure_stream: selected mode does not support range requests")
+	}
 
-	adjustedIV := adjustIVForOffset(iv, offset)
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return err
 	}
-	stream := cipher.NewCTR(block, adjustedIV)
-	streamReader := &cipher.StreamReader{S: stream, R: resp.Body}
+
+	streamReader, err := options.Mode.NewReader(block, iv, offset, resp.Body)
+	if err != nil {
+		return err
+	}
 
 	if byteRange != "" && resp.StatusCode == http.StatusPartialContent {
 		chunkLen := resp.ContentLength
@@ -128,12 +111,12 @@ func StreamFromUrlWithRange(w http.ResponseWriter, fileUrl string, key, iv []byt
 		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end, totalSize))
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", chunkLen))
 		w.Header().Set("Accept-Ranges", "bytes")
-		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Type", options.ContentType)
 		w.WriteHeader(http.StatusPartialContent)
 	} else {
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", totalSize))
 		w.Header().Set("Accept-Ranges", "bytes")
-		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Type", options.ContentType)
 		w.WriteHeader(http.StatusOK)
 	}
 
@@ -141,96 +124,178 @@ func StreamFromUrlWithRange(w http.ResponseWriter, fileUrl string, key, iv []byt
 	return err
 }
 
-func StreamFromByte(w http.ResponseWriter, data io.ReaderAt, size int64, key, iv []byte) error {
+// streamURLMultipartByteRanges serves a multi-range request against a
+// remote object. It first probes the object for its total size, splits
+// byteRange against that size, then fetches and decrypts each range with
+// its own request so every part gets a CTR-adjusted IV for its own offset.
+func streamURLMultipartByteRanges(w http.ResponseWriter, fileUrl string, key, iv []byte, byteRange string, options StreamOptions) error {
+	if !options.Mode.SupportsRandomAccess() {
+		return errors.New("secure_stream: selected mode does not support multi-range requests")
+	}
+
+	totalSize, err := probeUrlSize(fileUrl)
+	if err != nil {
+		return err
+	}
+
+	ranges, err := parseByteRanges(byteRange, totalSize)
+	if err != nil {
+		if errors.Is(err, ErrRangeNotSatisfiable) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", totalSize))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return nil
+		}
+		return err
+	}
+
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return err
 	}
 
-	stream := cipher.NewCTR(block, iv)
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(multipartByteRangesBoundary); err != nil {
+		return err
+	}
 
-	sectionReader := io.NewSectionReader(data, 0, size)
-	streamReader := &cipher.StreamReader{S: stream, R: sectionReader}
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/octet-stream")
+	for _, r := range ranges {
+		req, err := http.NewRequest("GET", fileUrl, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.Start, r.End))
 
-	_, err = io.Copy(w, streamReader)
-	return err
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", options.ContentType)
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, totalSize))
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			resp.Body.Close()
+			return err
+		}
+
+		streamReader, err := options.Mode.NewReader(block, iv, r.Start, resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return err
+		}
+		_, err = io.Copy(part, streamReader)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
 }
 
-func StreamFromByteWithRange(w http.ResponseWriter, data io.ReaderAt, size int64, key, iv []byte, byteRange string) error {
-	offset, length, err := parseByteRange(byteRange, size)
+// probeUrlSize requests only the first byte of fileUrl and learns its total
+// size from the Content-Range header. If the server ignores the Range
+// header, it falls back to Content-Length, and the whole body is read and
+// discarded.
+func probeUrlSize(fileUrl string) (int64, error) {
+	req, err := http.NewRequest("GET", fileUrl, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	req.Header.Set("Range", "bytes=0-0")
 
-	adjustedIV := adjustIVForOffset(iv, offset)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if cr := resp.Header.Get("Content-Range"); cr != "" {
+		var start, end, size int64
+		if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err == nil {
+			return size, nil
+		}
+	}
+	if cl := resp.Header.Get("Content-Length"); cl != "" {
+		if size, err := strconv.ParseInt(cl, 10, 64); err == nil {
+			return size, nil
+		}
+	}
+	return 0, errors.New("secure_stream: could not determine object size for multi-range request")
+}
+
+func StreamFromByte(w http.ResponseWriter, data io.ReaderAt, size int64, key, iv []byte, opts *StreamOptions) error {
+	options := resolveOptions(opts)
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return err
 	}
 
-	stream := cipher.NewCTR(block, adjustedIV)
-
-	sectionReader := io.NewSectionReader(data, offset, length)
-	streamReader := &cipher.StreamReader{S: stream, R: sectionReader}
-
-	if byteRange != "" {
-		w.WriteHeader(http.StatusPartialContent)
-		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
-	} else {
-		w.WriteHeader(http.StatusOK)
+	sectionReader := io.NewSectionReader(data, 0, size)
+	streamReader, err := options.Mode.NewReader(block, iv, 0, sectionReader)
+	if err != nil {
+		return err
 	}
-	w.Header().Set("Content-Type", "application/octet-stream")
+
+	w.Header().Set("Content-Type", options.ContentType)
+	w.WriteHeader(http.StatusOK)
 
 	_, err = io.Copy(w, streamReader)
 	return err
 }
 
-func parseRangeOffset(rangeHeader string) (int64, error) {
-	if !strings.HasPrefix(rangeHeader, "bytes=") {
-		return 0, nil
-	}
+func StreamFromByteWithRange(w http.ResponseWriter, data io.ReaderAt, size int64, key, iv []byte, byteRange string, opts *StreamOptions) error {
+	options := resolveOptions(opts)
 
-	rangePart := strings.TrimPrefix(rangeHeader, "bytes=")
-	parts := strings.Split(rangePart, "-")
-	if len(parts) != 2 {
-		return 0, errors.New("Invalid range format.")
+	ranges, err := parseByteRanges(byteRange, size)
+	if err != nil {
+		if errors.Is(err, ErrRangeNotSatisfiable) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return nil
+		}
+		return err
 	}
-	return strconv.ParseInt(parts[0], 10, 64)
-}
 
-func parseByteRange(byteRange string, size int64) (start int64, length int64, err error) {
-	if byteRange == "" {
-		return 0, size, nil
-	}
-	if !strings.HasPrefix(byteRange, "bytes=") {
-		return 0, 0, fmt.Errorf("invalid range header")
+	if len(ranges) > 1 {
+		return writeMultipartByteRanges(w, data, size, key, iv, ranges, options)
 	}
 
-	rangeParts := strings.Split(strings.TrimPrefix(byteRange, "bytes="), "-")
-	if len(rangeParts) != 2 {
-		return 0, 0, fmt.Errorf("invalid range format")
+	r := ranges[0]
+	offset, length := r.Start, r.length()
+
+	if offset != 0 && !options.Mode.SupportsRandomAccess() {
+		return errors.New("secure_stream: selected mode does not support range requests")
 	}
 
-	start, err = strconv.ParseInt(rangeParts[0], 10, 64)
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid start byte")
+		return err
 	}
 
-	end, err := strconv.ParseInt(rangeParts[1], 10, 64)
+	sectionReader := io.NewSectionReader(data, offset, length)
+	streamReader, err := options.Mode.NewReader(block, iv, offset, sectionReader)
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid end byte")
+		return err
 	}
 
-	if start > end || end >= size {
-		return 0, 0, fmt.Errorf("range out of bounds")
+	w.Header().Set("Content-Type", options.ContentType)
+	if byteRange != "" {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
 	}
 
-	length = end - start + 1
-	return start, length, nil
+	_, err = io.Copy(w, streamReader)
+	return err
 }
 
 func adjustIVForOffset(originalIV []byte, offset int64) []byte {
@@ -24,28 +24,6 @@ func TestAdjustIVForOffset(t *testing.T) {
 	}
 }
 
-func TestParseRangeOffset(t *testing.T) {
-	tests := []struct {
-		header   string
-		expected int64
-	}{
-		{"bytes=1024-2048", 1024},
-		{"bytes=0-100", 0},
-		{"", 0},
-	}
-
-	for _, ts := range tests {
-		result, err := parseRangeOffset(ts.header)
-		if err != nil {
-			t.Errorf("Unexpected error for %s: %v", ts.header, err)
-		}
-
-		if result != ts.expected {
-			t.Errorf("parseRangeOffset(%q) = %d, result: %d", ts.header, result, ts.expected)
-		}
-	}
-}
-
 func TestStreamFromUrl(t *testing.T) {
 	sourceContent := []byte("HelloSecureStreamingWorld!")
 
@@ -59,7 +37,7 @@ func TestStreamFromUrl(t *testing.T) {
 	iv := make([]byte, 16)
 
 	recorder := httptest.NewRecorder()
-	err := StreamFromUrl(recorder, mockServer.URL, key, iv)
+	err := StreamFromUrl(recorder, mockServer.URL, key, iv, nil)
 
 	if err != nil {
 		t.Fatalf("Stream error: %v", err)
@@ -77,42 +55,112 @@ func TestStreamFromUrl(t *testing.T) {
 	}
 }
 
+// TestStreamFromUrlWithRange decrypts a range whose start (6) is not a
+// multiple of the AES block size, so it only passes if the CTR keystream is
+// correctly realigned within the block, not just advanced by whole blocks.
+// The expected plaintext is never re-derived with adjustIVForOffset, so a
+// bug in that realignment can't cancel itself out against the test.
 func TestStreamFromUrlWithRange(t *testing.T) {
 	sourceContent := []byte("HelloSecureStreamingWorld!")
 
+	key := []byte("examplekey123456examplekey123456")
+	iv := make([]byte, 16)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+	ciphertext := make([]byte, len(sourceContent))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, sourceContent)
+
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rangeHeader := r.Header.Get("Range")
 		if rangeHeader == "bytes=6-25" {
-			w.Header().Set("Content-Range", "bytes 6-25/26")
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 6-25/%d", len(ciphertext)))
 			w.WriteHeader(http.StatusPartialContent)
-			w.Write(sourceContent[6:26])
+			w.Write(ciphertext[6:26])
 		} else {
-			w.Write(sourceContent)
+			w.Write(ciphertext)
 		}
-		fmt.Printf("Range header: %s\n", rangeHeader)
 	}))
 
 	defer mockServer.Close()
 
+	recorder := httptest.NewRecorder()
+	err = StreamFromUrlWithRange(recorder, mockServer.URL, key, iv, "bytes=6-25", nil)
+
+	if err != nil {
+		t.Fatalf("StreamWithRange error: %v", err)
+	}
+
+	expected := sourceContent[6:26]
+	if !bytes.Equal(recorder.Body.Bytes(), expected) {
+		t.Errorf("decryption mismatch, result: %s, expected: %s", recorder.Body.Bytes(), expected)
+	}
+}
+
+// TestStreamFromUrlWithRangeSuffix exercises the suffix-range form
+// (bytes=-N) against StreamFromUrlWithRange's single-range path, which
+// only parseByteRanges can resolve correctly since it needs the object's
+// total size to translate the suffix into an absolute start offset.
+func TestStreamFromUrlWithRangeSuffix(t *testing.T) {
+	sourceContent := []byte("HelloSecureStreamingWorld!")
+
 	key := []byte("examplekey123456examplekey123456")
 	iv := make([]byte, 16)
 
-	recorder := httptest.NewRecorder()
-	err := StreamFromUrlWithRange(recorder, mockServer.URL, key, iv, "bytes=6-25")
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+	ciphertext := make([]byte, len(sourceContent))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, sourceContent)
 
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=-10" {
+			start := len(ciphertext) - 10
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(ciphertext)-1, len(ciphertext)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(ciphertext[start:])
+		} else {
+			w.Write(ciphertext)
+		}
+	}))
+	defer mockServer.Close()
+
+	recorder := httptest.NewRecorder()
+	err = StreamFromUrlWithRange(recorder, mockServer.URL, key, iv, "bytes=-10", nil)
 	if err != nil {
-		t.Fatalf("StreamWithRange error: %v", err)
+		t.Fatalf("StreamFromUrlWithRange error: %v", err)
 	}
 
-	encrypted := recorder.Body.Bytes()
-	block, _ := aes.NewCipher(key)
-	stream := cipher.NewCTR(block, adjustIVForOffset(iv, 6))
-	decrypted := make([]byte, len(encrypted))
-	stream.XORKeyStream(decrypted, encrypted)
+	expected := sourceContent[len(sourceContent)-10:]
+	if !bytes.Equal(recorder.Body.Bytes(), expected) {
+		t.Errorf("decryption mismatch, result: %s, expected: %s", recorder.Body.Bytes(), expected)
+	}
+}
 
-	expected := sourceContent[6:26]
-	if !bytes.Equal(decrypted, expected) {
-		t.Errorf("decryption mismatch, result: %s, expected: %s", decrypted, expected)
+// TestStreamFromUrlWithRangeUnsatisfiable verifies that a range beyond the
+// object's size, as reported by the upstream response, is rejected with a
+// 416 by parseByteRanges' size check rather than being decrypted and served.
+func TestStreamFromUrlWithRangeUnsatisfiable(t *testing.T) {
+	sourceContent := []byte("HelloSecureStreamingWorld!")
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(sourceContent)
+	}))
+	defer mockServer.Close()
+
+	key := []byte("examplekey123456examplekey123456")
+	iv := make([]byte, 16)
+
+	recorder := httptest.NewRecorder()
+	err := StreamFromUrlWithRange(recorder, mockServer.URL, key, iv, "bytes=100000-200000", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recorder.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusRequestedRangeNotSatisfiable)
 	}
 }
 
@@ -126,7 +174,7 @@ func TestStreamFromByte(t *testing.T) {
 
 	recorder := httptest.NewRecorder()
 
-	err := StreamFromByte(recorder, data, size, key, iv)
+	err := StreamFromByte(recorder, data, size, key, iv, nil)
 	if err != nil {
 		t.Fatalf("Stream error: %v", err)
 	}
@@ -146,43 +194,39 @@ func TestStreamFromByte(t *testing.T) {
 	}
 }
 
+// TestStreamFromByteWithRange decrypts a range whose start (5) is not a
+// multiple of the AES block size, so it only passes if the CTR keystream is
+// correctly realigned within the block, not just advanced by whole blocks.
+// The ciphertext is produced independently of adjustIVForOffset (a single
+// whole-buffer encryption at offset 0), so a bug in that realignment can't
+// cancel itself out against the test.
 func TestStreamFromByteWithRange(t *testing.T) {
 	sourceData := []byte("HelloSecureStreamingWorld!")
-	data := bytes.NewReader(sourceData)
 	size := int64(len(sourceData))
 
 	key := []byte("examplekey123456examplekey123456")
 	iv := make([]byte, aes.BlockSize)
 
-	byteRange := "bytes=5-20"
-
-	recorder := httptest.NewRecorder()
-
-	err := StreamFromByteWithRange(recorder, data, size, key, iv, byteRange)
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		t.Fatalf("StreamFromByteWithRange error: %v", err)
+		t.Fatalf("aes.NewCipher: %v", err)
 	}
+	ciphertext := make([]byte, size)
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, sourceData)
 
-	encrypted := recorder.Body.Bytes()
+	byteRange := "bytes=5-20"
 
-	offset := int64(5)
-	adjustedIV := adjustIVForOffset(iv, offset)
+	recorder := httptest.NewRecorder()
 
-	block, err := aes.NewCipher(key)
+	err = StreamFromByteWithRange(recorder, bytes.NewReader(ciphertext), size, key, iv, byteRange, nil)
 	if err != nil {
-		t.Fatalf("AES cipher creation failed: %v", err)
+		t.Fatalf("StreamFromByteWithRange error: %v", err)
 	}
 
-	decrypter := cipher.NewCTR(block, adjustedIV)
-	decrypted := make([]byte, len(encrypted))
-	decrypter.XORKeyStream(decrypted, encrypted)
-	fmt.Printf("decrypted: %s\n", decrypted)
-
 	expected := sourceData[5 : 20+1]
-	if !bytes.Equal(decrypted, expected) {
-		t.Errorf("Decrypted data mismatch.\nResult: %s\nExpected: %s", decrypted, expected)
+	if !bytes.Equal(recorder.Body.Bytes(), expected) {
+		t.Errorf("Decrypted data mismatch.\nResult: %s\nExpected: %s", recorder.Body.Bytes(), expected)
 	}
-	fmt.Printf("expected: %s\n", expected)
 
 	contentRange := recorder.Header().Get("Content-Range")
 	expectedHeader := fmt.Sprintf("bytes 5-20/%d", size)